@@ -0,0 +1,29 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// ArchiveRetentionPolicy is a project's configured retention period for
+// archived workflow job logs. A project with no policy document falls back
+// to the service layer's default retention.
+type ArchiveRetentionPolicy struct {
+	ProjectName   string `bson:"project_name"   json:"projectName"`
+	RetentionDays int    `bson:"retention_days" json:"retentionDays"`
+}
+
+func (ArchiveRetentionPolicy) TableName() string {
+	return "archive_retention_policy"
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ExecAudit records a single interactive exec session opened against a
+// running workflow job container, so it is always possible to answer who
+// executed what on which task.
+type ExecAudit struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"            json:"id,omitempty"`
+	ProjectName   string             `bson:"project_name"             json:"projectName"`
+	WorkflowName  string             `bson:"workflow_name"            json:"workflowName"`
+	TaskID        int64              `bson:"task_id"                  json:"taskId"`
+	JobName       string             `bson:"job_name"                 json:"jobName"`
+	PodName       string             `bson:"pod_name"                 json:"podName"`
+	ContainerName string             `bson:"container_name"           json:"containerName"`
+	ClusterID     string             `bson:"cluster_id"                json:"clusterId"`
+	UserID        string             `bson:"user_id"                  json:"userId"`
+	UserName      string             `bson:"username"                 json:"username"`
+	Command       []string           `bson:"command"                  json:"command"`
+	StartTime     int64              `bson:"start_time"                json:"startTime"`
+	EndTime       int64              `bson:"end_time,omitempty"        json:"endTime,omitempty"`
+}
+
+func (ExecAudit) TableName() string {
+	return "exec_audit"
+}
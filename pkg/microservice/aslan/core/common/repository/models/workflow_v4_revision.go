@@ -0,0 +1,38 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// WorkflowV4Revision is a point-in-time snapshot of a WorkflowV4 document,
+// written before every Update/DeleteByID/Restore so the full edit history of
+// a workflow can be listed, diffed and rolled back to. Create writes none.
+type WorkflowV4Revision struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"    json:"id,omitempty"`
+	WorkflowID string             `bson:"workflow_id"      json:"workflowID"`
+	Revision   int64              `bson:"revision"         json:"revision"`
+	UpdatedBy  string             `bson:"updated_by"       json:"updatedBy"`
+	UpdatedAt  int64              `bson:"updated_at"       json:"updatedAt"`
+	// Deleted marks a revision written as the result of a soft-delete
+	// rather than an update/restore, so ListRevisions can render it distinctly.
+	Deleted  bool        `bson:"deleted"          json:"deleted"`
+	Snapshot *WorkflowV4 `bson:"snapshot"         json:"snapshot"`
+}
+
+func (WorkflowV4Revision) TableName() string {
+	return "workflow_v4_revision"
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	mongotool "github.com/koderover/zadig/pkg/tool/mongo"
+)
+
+type ArchiveRetentionColl struct {
+	*mongo.Collection
+
+	coll string
+}
+
+func NewArchiveRetentionColl() *ArchiveRetentionColl {
+	name := models.ArchiveRetentionPolicy{}.TableName()
+	return &ArchiveRetentionColl{
+		Collection: mongotool.Database(config.MongoDatabase()).Collection(name),
+		coll:       name,
+	}
+}
+
+func (c *ArchiveRetentionColl) GetCollectionName() string {
+	return c.coll
+}
+
+func (c *ArchiveRetentionColl) EnsureIndex(ctx context.Context) error {
+	mod := []mongo.IndexModel{
+		{
+			Keys:    bson.D{bson.E{Key: "project_name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	_, err := c.Indexes().CreateMany(ctx, mod)
+	return err
+}
+
+// Upsert sets projectName's archived-log retention period, creating the
+// policy document if it doesn't already exist.
+func (c *ArchiveRetentionColl) Upsert(projectName string, retentionDays int) error {
+	_, err := c.UpdateOne(context.TODO(),
+		bson.M{"project_name": projectName},
+		bson.M{"$set": bson.M{"retention_days": retentionDays}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (c *ArchiveRetentionColl) Get(projectName string) (*models.ArchiveRetentionPolicy, error) {
+	resp := new(models.ArchiveRetentionPolicy)
+	if err := c.FindOne(context.TODO(), bson.M{"project_name": projectName}).Decode(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ListAll returns every project's configured retention policy, so a
+// periodic cleanup job can iterate over it instead of needing the full
+// project list from elsewhere.
+func (c *ArchiveRetentionColl) ListAll(ctx context.Context) ([]*models.ArchiveRetentionPolicy, error) {
+	resp := make([]*models.ArchiveRetentionPolicy, 0)
+	cursor, err := c.Collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
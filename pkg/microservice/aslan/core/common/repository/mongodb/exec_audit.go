@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	mongotool "github.com/koderover/zadig/pkg/tool/mongo"
+)
+
+type ExecAuditColl struct {
+	*mongo.Collection
+
+	coll string
+}
+
+func NewExecAuditColl() *ExecAuditColl {
+	name := models.ExecAudit{}.TableName()
+	return &ExecAuditColl{
+		Collection: mongotool.Database(config.MongoDatabase()).Collection(name),
+		coll:       name,
+	}
+}
+
+func (c *ExecAuditColl) GetCollectionName() string {
+	return c.coll
+}
+
+func (c *ExecAuditColl) EnsureIndex(ctx context.Context) error {
+	mod := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				bson.E{Key: "workflow_name", Value: 1},
+				bson.E{Key: "task_id", Value: 1},
+			},
+		},
+	}
+	_, err := c.Indexes().CreateMany(ctx, mod)
+	return err
+}
+
+// Create inserts a record of an interactive exec session. It is written
+// when the session opens and updated with EndTime once it closes, so
+// audit.ID must be populated from the insert result for that later
+// SetEndTime call to find the right document.
+func (c *ExecAuditColl) Create(audit *models.ExecAudit) error {
+	res, err := c.InsertOne(context.TODO(), audit)
+	if err != nil {
+		return err
+	}
+	id, ok := res.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return errors.New("failed to get object id from create")
+	}
+	audit.ID = id
+	return nil
+}
+
+func (c *ExecAuditColl) SetEndTime(id primitive.ObjectID, endTime int64) error {
+	_, err := c.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": bson.M{"end_time": endTime}})
+	return err
+}
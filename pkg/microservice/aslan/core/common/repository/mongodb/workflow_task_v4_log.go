@@ -0,0 +1,46 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UpdateJobArchiveURL records the object storage URL that a job's archived
+// container log was uploaded to, once the in-flight log tee has finished
+// flushing it.
+func (c *WorkflowTaskv4Coll) UpdateJobArchiveURL(workflowName string, taskID int64, jobName, archiveURL string) error {
+	query := bson.M{
+		"workflow_name":    workflowName,
+		"task_id":          taskID,
+		"stages.jobs.name": jobName,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"stages.$[].jobs.$[job].log_archive_url": archiveURL,
+		},
+	}
+	arrayFilters := options.ArrayFilters{
+		Filters: []interface{}{bson.M{"job.name": jobName}},
+	}
+
+	_, err := c.UpdateOne(context.TODO(), query, update, options.Update().SetArrayFilters(arrayFilters))
+	return err
+}
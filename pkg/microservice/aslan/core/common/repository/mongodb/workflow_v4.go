@@ -29,6 +29,7 @@ import (
 
 	"github.com/koderover/zadig/pkg/microservice/aslan/config"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	"github.com/koderover/zadig/pkg/tool/log"
 	mongotool "github.com/koderover/zadig/pkg/tool/mongo"
 )
 
@@ -156,6 +157,12 @@ func (c *WorkflowV4Coll) BulkCreate(args []*models.WorkflowV4) error {
 	return err
 }
 
+// Create does not itself record a revision: the created document is already
+// the workflow's current state, and the first Update or DeleteByID called
+// against it will naturally capture it as revision 1 via recordRevision.
+// Writing a revision here too would duplicate that snapshot under revision
+// 1 and push every real edit's "before" state one revision number later
+// than a user browsing history would expect.
 func (c *WorkflowV4Coll) Create(obj *models.WorkflowV4) (string, error) {
 	if obj == nil {
 		return "", fmt.Errorf("nil object")
@@ -169,12 +176,13 @@ func (c *WorkflowV4Coll) Create(obj *models.WorkflowV4) (string, error) {
 	if !ok {
 		return "", errors.New("failed to get object id from create")
 	}
+
 	return ID.Hex(), err
 }
 
 func (c *WorkflowV4Coll) List(opt *ListWorkflowV4Option, pageNum, pageSize int64) ([]*models.WorkflowV4, int64, error) {
 	resp := make([]*models.WorkflowV4, 0)
-	query := bson.M{}
+	query := bson.M{"deleted": bson.M{"$ne": true}}
 	if opt.ProjectName != "" {
 		query["project"] = opt.ProjectName
 	}
@@ -210,7 +218,7 @@ func (c *WorkflowV4Coll) List(opt *ListWorkflowV4Option, pageNum, pageSize int64
 
 func (c *WorkflowV4Coll) Find(name string) (*models.WorkflowV4, error) {
 	resp := new(models.WorkflowV4)
-	query := bson.M{"name": name}
+	query := bson.M{"name": name, "deleted": bson.M{"$ne": true}}
 
 	err := c.FindOne(context.TODO(), query).Decode(&resp)
 	if err != nil {
@@ -219,6 +227,22 @@ func (c *WorkflowV4Coll) Find(name string) (*models.WorkflowV4, error) {
 	return resp, nil
 }
 
+// Restore clears the soft-delete flag set by DeleteByID, recording the
+// restore as a new revision, so a deleted workflow can come back from its
+// revision history.
+func (c *WorkflowV4Coll) Restore(idString string) error {
+	id, err := primitive.ObjectIDFromHex(idString)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": id}
+
+	c.recordRevision(idString, filter, false)
+
+	_, err = c.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"deleted": false}})
+	return err
+}
+
 func (c *WorkflowV4Coll) GetByID(idstring string) (*models.WorkflowV4, error) {
 	resp := new(models.WorkflowV4)
 	id, err := primitive.ObjectIDFromHex(idstring)
@@ -243,20 +267,61 @@ func (c *WorkflowV4Coll) Update(idString string, obj *models.WorkflowV4) error {
 		return fmt.Errorf("invalid id")
 	}
 	filter := bson.M{"_id": id}
-	update := bson.M{"$set": obj}
 
+	// Snapshot the document as it stood before this update is applied, so
+	// the revision history records what actually changed.
+	c.recordRevision(idString, filter, false)
+
+	update := bson.M{"$set": obj}
 	_, err = c.UpdateOne(context.TODO(), filter, update)
 	return err
 }
 
+// recordRevision copies the workflow document matched by filter into the
+// revision collection as the next sequential revision. deleted marks the
+// revision as the result of a soft-delete rather than an update/restore,
+// so ListRevisions can render it distinctly. Failures are logged
+// rather than returned, since a revision-history write should never block
+// the update it is recording.
+func (c *WorkflowV4Coll) recordRevision(workflowID string, filter bson.M, deleted bool) {
+	prev := new(models.WorkflowV4)
+	if err := c.FindOne(context.TODO(), filter).Decode(prev); err != nil {
+		log.Errorf("Failed to load workflow %s before recording revision: %s", workflowID, err)
+		return
+	}
+
+	revisionColl := NewWorkflowV4RevisionColl()
+	next, err := revisionColl.latestRevisionNumber(workflowID)
+	if err != nil {
+		log.Errorf("Failed to get latest revision number for workflow %s: %s", workflowID, err)
+		return
+	}
+
+	if err := revisionColl.Create(&models.WorkflowV4Revision{
+		WorkflowID: workflowID,
+		Revision:   next + 1,
+		UpdatedBy:  prev.UpdateBy,
+		UpdatedAt:  time.Now().Unix(),
+		Deleted:    deleted,
+		Snapshot:   prev,
+	}); err != nil {
+		log.Errorf("Failed to record revision %d for workflow %s: %s", next+1, workflowID, err)
+	}
+}
+
+// DeleteByID soft-deletes the workflow: it is flagged rather than removed,
+// so it stays restorable from its revision history, and the deletion itself
+// is recorded as a revision.
 func (c *WorkflowV4Coll) DeleteByID(idString string) error {
 	id, err := primitive.ObjectIDFromHex(idString)
 	if err != nil {
 		return err
 	}
-	query := bson.M{"_id": id}
+	filter := bson.M{"_id": id}
+
+	c.recordRevision(idString, filter, true)
 
-	_, err = c.DeleteOne(context.TODO(), query)
+	_, err = c.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"deleted": true}})
 	return err
 }
 
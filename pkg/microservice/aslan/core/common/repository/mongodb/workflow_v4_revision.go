@@ -0,0 +1,218 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	mongotool "github.com/koderover/zadig/pkg/tool/mongo"
+)
+
+type WorkflowV4RevisionColl struct {
+	*mongo.Collection
+
+	coll string
+}
+
+func NewWorkflowV4RevisionColl() *WorkflowV4RevisionColl {
+	name := models.WorkflowV4Revision{}.TableName()
+	return &WorkflowV4RevisionColl{
+		Collection: mongotool.Database(config.MongoDatabase()).Collection(name),
+		coll:       name,
+	}
+}
+
+func (c *WorkflowV4RevisionColl) GetCollectionName() string {
+	return c.coll
+}
+
+func (c *WorkflowV4RevisionColl) EnsureIndex(ctx context.Context) error {
+	mod := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				bson.E{Key: "workflow_id", Value: 1},
+				bson.E{Key: "revision", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	_, err := c.Indexes().CreateMany(ctx, mod)
+	return err
+}
+
+// Create inserts a new revision snapshot. Callers are responsible for
+// setting rev.Revision to the next sequential number for the workflow.
+func (c *WorkflowV4RevisionColl) Create(rev *models.WorkflowV4Revision) error {
+	_, err := c.InsertOne(context.TODO(), rev)
+	return err
+}
+
+// latestRevisionNumber returns the highest revision number recorded for a
+// workflow, or 0 if it has no revisions yet.
+func (c *WorkflowV4RevisionColl) latestRevisionNumber(workflowID string) (int64, error) {
+	opt := options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}})
+	resp := new(models.WorkflowV4Revision)
+	err := c.FindOne(context.TODO(), bson.M{"workflow_id": workflowID}, opt).Decode(resp)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return resp.Revision, nil
+}
+
+func (c *WorkflowV4RevisionColl) ListRevisions(workflowID string, pageNum, pageSize int64) ([]*models.WorkflowV4Revision, int64, error) {
+	resp := make([]*models.WorkflowV4Revision, 0)
+	query := bson.M{"workflow_id": workflowID}
+
+	count, err := c.CountDocuments(context.TODO(), query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	findOption := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}})
+	if pageNum > 0 && pageSize > 0 {
+		findOption = findOption.SetSkip((pageNum - 1) * pageSize).SetLimit(pageSize)
+	}
+
+	cursor, err := c.Collection.Find(context.TODO(), query, findOption)
+	if err != nil {
+		return nil, count, err
+	}
+	if err := cursor.All(context.TODO(), &resp); err != nil {
+		return nil, count, err
+	}
+	return resp, count, nil
+}
+
+func (c *WorkflowV4RevisionColl) GetRevision(workflowID string, revision int64) (*models.WorkflowV4Revision, error) {
+	resp := new(models.WorkflowV4Revision)
+	query := bson.M{"workflow_id": workflowID, "revision": revision}
+
+	err := c.FindOne(context.TODO(), query).Decode(resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RevisionDiff is a structural diff between two revisions of a workflow's
+// stages and jobs, at the granularity the UI's history tab renders: which
+// stages/jobs were added or removed, and which jobs kept their name but had
+// their configuration changed.
+type RevisionDiff struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+
+	AddedStages   []string `json:"addedStages"`
+	RemovedStages []string `json:"removedStages"`
+	AddedJobs     []string `json:"addedJobs"`
+	RemovedJobs   []string `json:"removedJobs"`
+	ChangedJobs   []string `json:"changedJobs"`
+}
+
+func (c *WorkflowV4RevisionColl) DiffRevisions(workflowID string, from, to int64) (*RevisionDiff, error) {
+	fromRev, err := c.GetRevision(workflowID, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revision %d: %w", from, err)
+	}
+	toRev, err := c.GetRevision(workflowID, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revision %d: %w", to, err)
+	}
+
+	diff := &RevisionDiff{From: from, To: to}
+
+	fromStages := map[string]bool{}
+	fromJobs := map[string][]byte{}
+	if fromRev.Snapshot != nil {
+		for _, stage := range fromRev.Snapshot.Stages {
+			fromStages[stage.Name] = true
+			for _, job := range stage.Jobs {
+				fromJobs[stage.Name+"/"+job.Name], _ = json.Marshal(job)
+			}
+		}
+	}
+
+	toStages := map[string]bool{}
+	toJobs := map[string][]byte{}
+	if toRev.Snapshot != nil {
+		for _, stage := range toRev.Snapshot.Stages {
+			toStages[stage.Name] = true
+			for _, job := range stage.Jobs {
+				toJobs[stage.Name+"/"+job.Name], _ = json.Marshal(job)
+			}
+		}
+	}
+
+	for name := range toStages {
+		if !fromStages[name] {
+			diff.AddedStages = append(diff.AddedStages, name)
+		}
+	}
+	for name := range fromStages {
+		if !toStages[name] {
+			diff.RemovedStages = append(diff.RemovedStages, name)
+		}
+	}
+	for key, toSpec := range toJobs {
+		fromSpec, ok := fromJobs[key]
+		if !ok {
+			diff.AddedJobs = append(diff.AddedJobs, key)
+			continue
+		}
+		if !bytes.Equal(fromSpec, toSpec) {
+			diff.ChangedJobs = append(diff.ChangedJobs, key)
+		}
+	}
+	for key := range fromJobs {
+		if _, ok := toJobs[key]; !ok {
+			diff.RemovedJobs = append(diff.RemovedJobs, key)
+		}
+	}
+
+	return diff, nil
+}
+
+// Rollback atomically replaces the live workflow document with the snapshot
+// recorded at the given revision, and records the rollback itself as a new
+// revision so the history never loses track of what happened.
+func (c *WorkflowV4RevisionColl) Rollback(workflowID, idString string, revision int64, updatedBy string) error {
+	rev, err := c.GetRevision(workflowID, revision)
+	if err != nil {
+		return fmt.Errorf("failed to get revision %d: %w", revision, err)
+	}
+	if rev.Snapshot == nil {
+		return fmt.Errorf("revision %d has no snapshot", revision)
+	}
+	rev.Snapshot.UpdateBy = updatedBy
+
+	if err := NewWorkflowV4Coll().Update(idString, rev.Snapshot); err != nil {
+		return fmt.Errorf("failed to roll back workflow %s to revision %d: %w", workflowID, revision, err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package log archives workflow job container logs to object storage so
+// they remain available once the Kubernetes Job that produced them has been
+// garbage collected, and serves them back out once a task has finished.
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	s3tool "github.com/koderover/zadig/pkg/tool/s3"
+)
+
+const (
+	// archiveFlushSize is the amount of gzip-compressed log data buffered
+	// before a chunk is flushed to object storage as a multipart part. S3
+	// rejects any part smaller than 5MiB except the last one
+	// (EntityTooSmall), so this must stay at or above that floor.
+	archiveFlushSize = 8 << 20 // 8MiB
+
+	// defaultRetentionDays is used when a project has not configured its
+	// own archived-log retention period.
+	defaultRetentionDays = 30
+)
+
+// ArchiveOptions identifies the workflow job whose log is being archived.
+type ArchiveOptions struct {
+	ProjectName  string
+	WorkflowName string
+	TaskID       int64
+	JobName      string
+}
+
+// objectKey follows the workflowv4/<project>/<workflow>/<taskID>/<jobName>.log.gz
+// layout so an archive can be located without a database lookup.
+func (o *ArchiveOptions) objectKey() string {
+	return fmt.Sprintf("workflowv4/%s/%s/%d/%s.log.gz", o.ProjectName, o.WorkflowName, o.TaskID, o.JobName)
+}
+
+// Archiver tees container log lines into a gzip-compressed object uploaded
+// to the project's configured S3/OSS backend in multipart chunks. It is not
+// safe for concurrent use; one Archiver is created per job log stream.
+type Archiver struct {
+	opt *ArchiveOptions
+	log *zap.SugaredLogger
+
+	storage *s3tool.Client
+	key     string
+	upload  *s3tool.MultipartUpload
+
+	raw *bytes.Buffer
+	gz  *gzip.Writer
+}
+
+// NewArchiver looks up the object storage backend configured for
+// opt.ProjectName and opens a multipart upload for the job's archive key.
+func NewArchiver(opt *ArchiveOptions, log *zap.SugaredLogger) (*Archiver, error) {
+	storage, err := s3tool.NewClientForProject(opt.ProjectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object storage client for project %s: %w", opt.ProjectName, err)
+	}
+
+	key := opt.objectKey()
+	upload, err := storage.InitMultipartUpload(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init multipart upload for %s: %w", key, err)
+	}
+
+	a := &Archiver{opt: opt, log: log, storage: storage, key: key, upload: upload, raw: &bytes.Buffer{}}
+	a.gz = gzip.NewWriter(a.raw)
+	return a, nil
+}
+
+// Write buffers and gzips a single log line, flushing a multipart chunk to
+// object storage once archiveFlushSize of compressed data has accumulated.
+func (a *Archiver) Write(line string) {
+	if _, err := a.gz.Write([]byte(line + "\n")); err != nil {
+		a.log.Errorf("[LogArchiver] failed to write line to gzip buffer for %s: %v", a.key, err)
+		return
+	}
+	if a.raw.Len() >= archiveFlushSize {
+		a.flush()
+	}
+}
+
+func (a *Archiver) flush() {
+	if err := a.gz.Flush(); err != nil {
+		a.log.Errorf("[LogArchiver] failed to flush gzip writer for %s: %v", a.key, err)
+		return
+	}
+	if a.raw.Len() == 0 {
+		return
+	}
+	if err := a.upload.UploadPart(a.raw.Bytes()); err != nil {
+		a.log.Errorf("[LogArchiver] failed to upload part for %s: %v", a.key, err)
+		return
+	}
+	a.raw.Reset()
+}
+
+// Close finalizes the gzip stream, uploads any remaining data, completes the
+// multipart upload and records the resulting archive URL on the JobTask so
+// subsequent requests for this job's log can be served from object storage.
+// It returns the archive URL.
+func (a *Archiver) Close() (string, error) {
+	if err := a.gz.Close(); err != nil {
+		return "", fmt.Errorf("failed to close gzip writer for %s: %w", a.key, err)
+	}
+	if a.raw.Len() > 0 {
+		if err := a.upload.UploadPart(a.raw.Bytes()); err != nil {
+			return "", fmt.Errorf("failed to upload final part for %s: %w", a.key, err)
+		}
+	}
+	url, err := a.upload.Complete()
+	if err != nil {
+		return "", fmt.Errorf("failed to complete multipart upload for %s: %w", a.key, err)
+	}
+
+	if err := commonrepo.NewworkflowTaskv4Coll().UpdateJobArchiveURL(a.opt.WorkflowName, a.opt.TaskID, a.opt.JobName, url); err != nil {
+		a.log.Errorf("[LogArchiver] failed to record archive URL for %s/%d/%s: %v", a.opt.WorkflowName, a.opt.TaskID, a.opt.JobName, err)
+	}
+	return url, nil
+}
+
+// StreamArchivedLog downloads a previously archived, gzip-compressed job log
+// and pushes it into streamChan line-by-line, so the SSE handler can serve a
+// finished task's log the same way it serves a live one.
+func StreamArchivedLog(ctx context.Context, streamChan chan interface{}, opt *ArchiveOptions, log *zap.SugaredLogger) error {
+	storage, err := s3tool.NewClientForProject(opt.ProjectName)
+	if err != nil {
+		return fmt.Errorf("failed to get object storage client for project %s: %w", opt.ProjectName, err)
+	}
+
+	object, err := storage.Download(opt.objectKey())
+	if err != nil {
+		return fmt.Errorf("failed to download archived log %s: %w", opt.objectKey(), err)
+	}
+	defer object.Close()
+
+	gzReader, err := gzip.NewReader(object)
+	if err != nil {
+		return fmt.Errorf("failed to open gzip reader for %s: %w", opt.objectKey(), err)
+	}
+	defer gzReader.Close()
+
+	buf := bufio.NewReader(gzReader)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			line, err := buf.ReadString('\n')
+			if len(line) > 0 {
+				streamChan <- line
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read archived log %s: %w", opt.objectKey(), err)
+			}
+		}
+	}
+}
+
+// GetArchiveRetentionDays returns projectName's configured archived-log
+// retention period, or defaultRetentionDays if the project has not
+// configured one.
+func GetArchiveRetentionDays(projectName string, log *zap.SugaredLogger) int {
+	policy, err := commonrepo.NewArchiveRetentionColl().Get(projectName)
+	if err != nil {
+		return defaultRetentionDays
+	}
+	if policy.RetentionDays <= 0 {
+		return defaultRetentionDays
+	}
+	return policy.RetentionDays
+}
+
+// SetArchiveRetentionDays configures projectName's archived-log retention
+// period. Passing retentionDays <= 0 is rejected rather than silently
+// falling back to the default, so a caller can't accidentally wipe a
+// project's policy with a zero value.
+func SetArchiveRetentionDays(projectName string, retentionDays int, log *zap.SugaredLogger) error {
+	if retentionDays <= 0 {
+		return fmt.Errorf("retentionDays must be positive, got %d", retentionDays)
+	}
+	if err := commonrepo.NewArchiveRetentionColl().Upsert(projectName, retentionDays); err != nil {
+		log.Errorf("[LogArchiver] failed to set retention policy for project %s: %v", projectName, err)
+		return err
+	}
+	return nil
+}
+
+// CleanupAllProjectsExpiredArchives runs CleanupExpiredArchives for every
+// project with a configured retention policy. A failure on one project is
+// logged and does not stop the rest from being cleaned up.
+func CleanupAllProjectsExpiredArchives(ctx context.Context, log *zap.SugaredLogger) error {
+	policies, err := commonrepo.NewArchiveRetentionColl().ListAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list archive retention policies: %w", err)
+	}
+
+	for _, policy := range policies {
+		if err := CleanupExpiredArchives(policy.ProjectName, policy.RetentionDays, log); err != nil {
+			log.Errorf("[LogArchiver] failed to clean up expired archives for project %s: %v", policy.ProjectName, err)
+		}
+	}
+	return nil
+}
+
+// RunScheduledArchiveCleanup runs CleanupAllProjectsExpiredArchives once per
+// interval until ctx is cancelled. It is meant to be started as a goroutine
+// from the service's periodic-job scheduler.
+func RunScheduledArchiveCleanup(ctx context.Context, interval time.Duration, log *zap.SugaredLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := CleanupAllProjectsExpiredArchives(ctx, log); err != nil {
+				log.Errorf("[LogArchiver] scheduled archive cleanup failed: %v", err)
+			}
+		}
+	}
+}
+
+// CleanupExpiredArchives deletes archived job logs older than the project's
+// configured retention period (defaultRetentionDays when unset). It is
+// called for one project at a time, either directly or via
+// CleanupAllProjectsExpiredArchives's periodic sweep.
+func CleanupExpiredArchives(projectName string, retentionDays int, log *zap.SugaredLogger) error {
+	if retentionDays <= 0 {
+		retentionDays = defaultRetentionDays
+	}
+
+	storage, err := s3tool.NewClientForProject(projectName)
+	if err != nil {
+		return fmt.Errorf("failed to get object storage client for project %s: %w", projectName, err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	keys, err := storage.ListObjectsOlderThan(fmt.Sprintf("workflowv4/%s/", projectName), cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to list archived logs for project %s: %w", projectName, err)
+	}
+
+	for _, key := range keys {
+		if err := storage.Delete(key); err != nil {
+			log.Errorf("[LogArchiver] failed to delete expired archive %s: %v", key, err)
+			continue
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import "testing"
+
+func TestObjectKey(t *testing.T) {
+	opt := &ArchiveOptions{
+		ProjectName:  "demo",
+		WorkflowName: "build-and-deploy",
+		TaskID:       42,
+		JobName:      "build",
+	}
+
+	want := "workflowv4/demo/build-and-deploy/42/build.log.gz"
+	if got := opt.objectKey(); got != want {
+		t.Errorf("objectKey() = %q, want %q", got, want)
+	}
+}
+
+// TestArchiveFlushSizeMeetsS3Minimum guards against regressing to a chunk
+// size S3 rejects with EntityTooSmall for any non-final multipart part.
+func TestArchiveFlushSizeMeetsS3Minimum(t *testing.T) {
+	const s3MinPartSize = 5 << 20
+	if archiveFlushSize < s3MinPartSize {
+		t.Errorf("archiveFlushSize = %d, must be >= S3's 5MiB minimum part size (%d)", archiveFlushSize, s3MinPartSize)
+	}
+}
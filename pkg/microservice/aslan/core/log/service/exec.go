@@ -0,0 +1,198 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/config"
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
+	"github.com/koderover/zadig/pkg/tool/kube/getter"
+)
+
+// resizeMessage is sent by the frontend terminal whenever the user resizes
+// their browser window, so the remote PTY can be kept in sync.
+type resizeMessage struct {
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+// wsTerminalStream adapts a websocket connection to remotecommand's
+// TerminalSizeQueue/stdin/stdout contract: JSON text frames carry PTY
+// resize events, any other text or binary frame carries raw stdin bytes,
+// and stdout/stderr are written back as binary frames.
+type wsTerminalStream struct {
+	conn     *websocket.Conn
+	sizeChan chan remotecommand.TerminalSize
+}
+
+func newWsTerminalStream(conn *websocket.Conn) *wsTerminalStream {
+	return &wsTerminalStream{conn: conn, sizeChan: make(chan remotecommand.TerminalSize, 1)}
+}
+
+func (s *wsTerminalStream) Read(p []byte) (int, error) {
+	for {
+		msgType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		// Resize control messages are only ever sent as JSON text frames;
+		// raw keystrokes may arrive as either text or binary frames
+		// depending on how the frontend terminal encodes them, so both
+		// must reach stdin instead of only text frames.
+		if msgType == websocket.TextMessage {
+			var resize resizeMessage
+			if err := json.Unmarshal(data, &resize); err == nil && resize.Cols > 0 && resize.Rows > 0 {
+				s.sizeChan <- remotecommand.TerminalSize{Width: resize.Cols, Height: resize.Rows}
+				continue
+			}
+		}
+		if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+			continue
+		}
+		return copy(p, data), nil
+	}
+}
+
+func (s *wsTerminalStream) Write(p []byte) (int, error) {
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *wsTerminalStream) Next() *remotecommand.TerminalSize {
+	size, ok := <-s.sizeChan
+	if !ok {
+		return nil
+	}
+	return &size
+}
+
+// ExecAuthorizer authorizes a user to open an interactive exec session
+// against a project's workflow job. WorkflowTaskV4ExecStream refuses to
+// proceed without one, so opening a shell into a live container can never
+// depend on a caller remembering to check permissions first.
+type ExecAuthorizer interface {
+	// AuthorizeExec returns nil if uid is permitted to exec into jobs
+	// running under projectName, and a descriptive error otherwise.
+	AuthorizeExec(projectName, uid string) error
+}
+
+// WorkflowTaskV4ExecStream opens an interactive exec session, equivalent to
+// `kubectl exec -it`, against the pod running the given workflow job. It
+// shares resolveWorkflowJob's pod-discovery logic with
+// WorkflowTaskV4ContainerLogStream so the selector, cluster and namespace
+// resolution stay identical between viewing logs and opening a shell.
+func WorkflowTaskV4ExecStream(ctx context.Context, wsConn *websocket.Conn, options *GetContainerOptions, uid, username string, authz ExecAuthorizer, log *zap.SugaredLogger) error {
+	if options == nil {
+		return fmt.Errorf("nil options")
+	}
+	if authz == nil {
+		return fmt.Errorf("exec session denied: no authorizer configured")
+	}
+	if err := authz.AuthorizeExec(options.ProductName, uid); err != nil {
+		return fmt.Errorf("exec session denied: %w", err)
+	}
+
+	selector, _, running, err := resolveWorkflowJob(options, log)
+	if err != nil {
+		return err
+	}
+	if !running {
+		return fmt.Errorf("job %s is not running, cannot open an exec session", options.SubTask)
+	}
+
+	kubeClient, err := kubeclient.GetKubeClient(config.HubServerAddress(), options.ClusterID)
+	if err != nil {
+		return fmt.Errorf("failed to get kube client: %w", err)
+	}
+	pods, err := getter.ListPods(options.Namespace, selector, kubeClient)
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("no running pod found for job %s", options.SubTask)
+	}
+	pod := pods[0]
+
+	restConfig, err := kubeclient.GetRESTConfig(config.HubServerAddress(), options.ClusterID)
+	if err != nil {
+		return fmt.Errorf("failed to get rest config: %w", err)
+	}
+
+	req := restConfig.RESTClient().Post().
+		Resource("pods").
+		Namespace(options.Namespace).
+		Name(pod.Name).
+		SubResource("exec")
+	req.VersionedParams(&corev1.PodExecOptions{
+		Container: options.SubTask,
+		Command:   []string{"/bin/sh"},
+		Stdin:     true,
+		Stdout:    true,
+		Stderr:    true,
+		TTY:       true,
+	}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(restConfig, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+
+	audit := &models.ExecAudit{
+		ProjectName:   options.ProductName,
+		WorkflowName:  options.PipelineName,
+		TaskID:        options.TaskID,
+		JobName:       options.SubTask,
+		PodName:       pod.Name,
+		ContainerName: options.SubTask,
+		ClusterID:     options.ClusterID,
+		UserID:        uid,
+		UserName:      username,
+		Command:       []string{"/bin/sh"},
+		StartTime:     time.Now().Unix(),
+	}
+	if err := commonrepo.NewExecAuditColl().Create(audit); err != nil {
+		log.Errorf("[WorkflowTaskV4ExecStream] failed to write exec audit log: %v", err)
+	}
+	defer func() {
+		if err := commonrepo.NewExecAuditColl().SetEndTime(audit.ID, time.Now().Unix()); err != nil {
+			log.Errorf("[WorkflowTaskV4ExecStream] failed to close exec audit log: %v", err)
+		}
+	}()
+
+	stream := newWsTerminalStream(wsConn)
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:             stream,
+		Stdout:            stream,
+		Stderr:            stream,
+		Tty:               true,
+		TerminalSizeQueue: stream,
+	})
+}
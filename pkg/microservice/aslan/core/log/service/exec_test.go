@@ -0,0 +1,136 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialServerSide spins up a one-shot websocket server and returns the
+// server-side *websocket.Conn wsTerminalStream wraps, plus the client-side
+// conn the test drives directly.
+func dialServerSide(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	serverConnCh := make(chan *websocket.Conn, 1)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		serverConnCh <- conn
+	}))
+	t.Cleanup(s.Close)
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http")
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	select {
+	case server = <-serverConnCh:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for server-side connection")
+	}
+	t.Cleanup(func() { server.Close() })
+	return server, client
+}
+
+func TestWsTerminalStreamReadPassesBinaryFramesAsStdin(t *testing.T) {
+	server, client := dialServerSide(t)
+	stream := newWsTerminalStream(server)
+
+	if err := client.WriteMessage(websocket.BinaryMessage, []byte("ls -la\n")); err != nil {
+		t.Fatalf("failed to write binary frame: %v", err)
+	}
+
+	buf := make([]byte, 64)
+	n, err := stream.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got := string(buf[:n]); got != "ls -la\n" {
+		t.Errorf("Read() = %q, want %q", got, "ls -la\n")
+	}
+}
+
+func TestWsTerminalStreamReadHandlesResizeThenStdin(t *testing.T) {
+	server, client := dialServerSide(t)
+	stream := newWsTerminalStream(server)
+
+	resize := `{"cols":120,"rows":40}`
+	if err := client.WriteMessage(websocket.TextMessage, []byte(resize)); err != nil {
+		t.Fatalf("failed to write resize frame: %v", err)
+	}
+	if err := client.WriteMessage(websocket.BinaryMessage, []byte("echo hi\n")); err != nil {
+		t.Fatalf("failed to write binary frame: %v", err)
+	}
+
+	buf := make([]byte, 64)
+	n, err := stream.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got := string(buf[:n]); got != "echo hi\n" {
+		t.Errorf("Read() = %q, want %q after resize frame was consumed", got, "echo hi\n")
+	}
+
+	size := stream.Next()
+	if size == nil || size.Width != 120 || size.Height != 40 {
+		t.Errorf("Next() = %+v, want {Width:120 Height:40}", size)
+	}
+}
+
+type fakeAuthorizer struct {
+	err error
+}
+
+func (f fakeAuthorizer) AuthorizeExec(projectName, uid string) error {
+	return f.err
+}
+
+func TestWorkflowTaskV4ExecStreamRequiresAuthorizer(t *testing.T) {
+	options := &GetContainerOptions{ProductName: "demo", SubTask: "build"}
+
+	if err := WorkflowTaskV4ExecStream(nil, nil, options, "u1", "alice", nil, nil); err == nil {
+		t.Fatal("expected an error when no authorizer is configured, got nil")
+	}
+}
+
+func TestWorkflowTaskV4ExecStreamRejectsDeniedUser(t *testing.T) {
+	options := &GetContainerOptions{ProductName: "demo", SubTask: "build"}
+	authz := fakeAuthorizer{err: fmt.Errorf("user is not a project member")}
+
+	err := WorkflowTaskV4ExecStream(nil, nil, options, "u1", "alice", authz, nil)
+	if err == nil {
+		t.Fatal("expected an error when the authorizer denies the user, got nil")
+	}
+	if !strings.Contains(err.Error(), "exec session denied") {
+		t.Errorf("error = %v, want it to be wrapped as an exec session denial", err)
+	}
+}
@@ -22,9 +22,13 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 
@@ -32,6 +36,7 @@ import (
 	commonmodels "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
 	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
 	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/kube"
+	logarchive "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/log"
 	"github.com/koderover/zadig/pkg/setting"
 	kubeclient "github.com/koderover/zadig/pkg/shared/kube/client"
 	"github.com/koderover/zadig/pkg/tool/kube/containerlog"
@@ -59,6 +64,19 @@ type GetContainerOptions struct {
 	EnvName       string
 	ProductName   string
 	ClusterID     string
+	// Parallel forces every matched pod to be streamed at once, with each
+	// line tagged by its source pod. When false, it is still enabled
+	// automatically once more than one pod matches the selector.
+	Parallel bool
+}
+
+// PodLogLine is a single log line tagged with the pod it came from, used to
+// multiplex the combined output of a job that fans out across several pods
+// (e.g. parallel test sharding) onto a single SSE stream.
+type PodLogLine struct {
+	Pod   string `json:"pod_name"`
+	Index int    `json:"pod_index"`
+	Line  string `json:"line"`
 }
 
 func ContainerLogStream(ctx context.Context, streamChan chan interface{}, envName, productName, podName, containerName string, follow bool, tailLines int64, log *zap.SugaredLogger) {
@@ -207,16 +225,18 @@ func TaskContainerLogStream(ctx context.Context, streamChan chan interface{}, op
 	waitAndGetLog(ctx, streamChan, selector, options, log)
 }
 
-func WorkflowTaskV4ContainerLogStream(ctx context.Context, streamChan chan interface{}, options *GetContainerOptions, log *zap.SugaredLogger) {
-	if options == nil {
-		return
-	}
-	log.Debugf("Start to get task container log.")
+// resolveWorkflowJob locates the job named options.SubTask within the given
+// workflow task, fills in options.JobName/JobType/ClusterID/Namespace from
+// its spec, and returns the label selector that matches its pod(s) plus the
+// archive URL recorded for it (if the log has already been archived).
+// WorkflowTaskV4ContainerLogStream and WorkflowTaskV4ExecStream share this so
+// pod discovery stays identical between viewing logs and opening a shell.
+func resolveWorkflowJob(options *GetContainerOptions, log *zap.SugaredLogger) (selector labels.Selector, archiveURL string, running bool, err error) {
 	task, err := commonrepo.NewworkflowTaskv4Coll().Find(options.PipelineName, options.TaskID)
 	if err != nil {
-		log.Errorf("Failed to find workflow %s taskID %s: %v", options.PipelineName, options.TaskID, err)
-		return
+		return nil, "", false, fmt.Errorf("failed to find workflow %s taskID %d: %w", options.PipelineName, options.TaskID, err)
 	}
+
 	for _, stage := range task.Stages {
 		for _, job := range stage.Jobs {
 			if job.Name != options.SubTask {
@@ -224,6 +244,7 @@ func WorkflowTaskV4ContainerLogStream(ctx context.Context, streamChan chan inter
 			}
 			options.JobName = job.K8sJobName
 			options.JobType = job.JobType
+			archiveURL = job.LogArchiveURL
 			switch job.JobType {
 			case string(config.JobZadigBuild):
 				fallthrough
@@ -238,20 +259,17 @@ func WorkflowTaskV4ContainerLogStream(ctx context.Context, streamChan chan inter
 			case string(config.JobBuild):
 				jobSpec := &commonmodels.JobTaskFreestyleSpec{}
 				if err := commonmodels.IToi(job.Spec, jobSpec); err != nil {
-					log.Errorf("Failed to parse job spec: %v", err)
-					return
+					return nil, "", false, fmt.Errorf("failed to parse job spec: %w", err)
 				}
 				options.ClusterID = jobSpec.Properties.ClusterID
 			case string(config.JobPlugin):
 				jobSpec := &commonmodels.JobTaskPluginSpec{}
 				if err := commonmodels.IToi(job.Spec, jobSpec); err != nil {
-					log.Errorf("Failed to parse job spec: %v", err)
-					return
+					return nil, "", false, fmt.Errorf("failed to parse job spec: %w", err)
 				}
 				options.ClusterID = jobSpec.Properties.ClusterID
 			default:
-				log.Errorf("get real-time log error, unsupported job type %s", job.JobType)
-				return
+				return nil, "", false, fmt.Errorf("get real-time log error, unsupported job type %s", job.JobType)
 			}
 			if options.ClusterID == "" {
 				options.ClusterID = setting.LocalClusterID
@@ -266,8 +284,87 @@ func WorkflowTaskV4ContainerLogStream(ctx context.Context, streamChan chan inter
 		}
 	}
 
-	selector := getWorkflowSelector(options)
-	waitAndGetLog(ctx, streamChan, selector, options, log)
+	return getWorkflowSelector(options), archiveURL, task.Status == config.StatusRunning, nil
+}
+
+func WorkflowTaskV4ContainerLogStream(ctx context.Context, streamChan chan interface{}, options *GetContainerOptions, log *zap.SugaredLogger) {
+	if options == nil {
+		return
+	}
+	log.Debugf("Start to get task container log.")
+	selector, archiveURL, running, err := resolveWorkflowJob(options, log)
+	if err != nil {
+		log.Errorf("%v", err)
+		return
+	}
+
+	// The Kubernetes Job backing a finished task is eventually garbage
+	// collected, so once the task is done we serve its log from the
+	// archive instead of trying to find a pod that no longer exists.
+	if archiveURL != "" && !running {
+		archiveOpt := &logarchive.ArchiveOptions{
+			ProjectName:  options.ProductName,
+			WorkflowName: options.PipelineName,
+			TaskID:       options.TaskID,
+			JobName:      options.SubTask,
+		}
+		if err := logarchive.StreamArchivedLog(ctx, streamChan, archiveOpt, log); err != nil {
+			log.Errorf("Failed to stream archived log for %s taskID %d job %s: %v", options.PipelineName, options.TaskID, options.SubTask, err)
+		}
+		return
+	}
+
+	waitAndGetLog(ctx, archiveTeeChan(ctx, streamChan, options, log), selector, options, log)
+}
+
+// archiveTeeChan duplicates every container log line passed to it into a
+// gzip archive uploaded to object storage, so the log survives after the
+// Kubernetes Job producing it is garbage collected. On failure to start the
+// archiver, it falls back to the unmodified streamChan so live viewers are
+// unaffected.
+func archiveTeeChan(ctx context.Context, streamChan chan interface{}, options *GetContainerOptions, log *zap.SugaredLogger) chan interface{} {
+	archiver, err := logarchive.NewArchiver(&logarchive.ArchiveOptions{
+		ProjectName:  options.ProductName,
+		WorkflowName: options.PipelineName,
+		TaskID:       options.TaskID,
+		JobName:      options.SubTask,
+	}, log)
+	if err != nil {
+		log.Errorf("[GetContainerLogsSSE] failed to start log archiver, log will not be retained: %v", err)
+		return streamChan
+	}
+
+	relay := make(chan interface{})
+	go func() {
+		defer func() {
+			if _, err := archiver.Close(); err != nil {
+				log.Errorf("[GetContainerLogsSSE] failed to finalize log archive: %v", err)
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line, ok := <-relay:
+				if !ok {
+					return
+				}
+				switch v := line.(type) {
+				case string:
+					archiver.Write(v)
+				case *PodLogLine:
+					// A fanned-out job's combined stream tags each line
+					// with its source pod; keep that in the archive too
+					// instead of silently dropping multiplexed output.
+					archiver.Write(fmt.Sprintf("%s: %s", v.Pod, v.Line))
+				default:
+					log.Errorf("[GetContainerLogsSSE] unexpected log line type %T, not archived", line)
+				}
+				streamChan <- line
+			}
+		}
+	}()
+	return relay
 }
 
 func TestJobContainerLogStream(ctx context.Context, streamChan chan interface{}, options *GetContainerOptions, log *zap.SugaredLogger) {
@@ -332,7 +429,11 @@ func waitAndGetLog(ctx context.Context, streamChan chan interface{}, selector la
 
 	log.Debugf("Found %d running pods", len(pods))
 
-	if len(pods) > 0 {
+	if len(pods) == 0 {
+		return
+	}
+
+	if len(pods) == 1 && !options.Parallel {
 		containerLogStream(
 			ctx, streamChan,
 			options.Namespace,
@@ -342,7 +443,141 @@ func waitAndGetLog(ctx context.Context, streamChan chan interface{}, selector la
 			clientSet,
 			log,
 		)
+		return
+	}
+
+	log.Infof("[GetContainerLogsSSE] job fanned out to %d pods, multiplexing combined log stream", len(pods))
+	var wg sync.WaitGroup
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(index int, podName string) {
+			defer wg.Done()
+			multiplexedContainerLogStream(ctx, streamChan, options.Namespace, podName, options.SubTask, index, options.TailLines, clientSet, log)
+		}(i, pod.Name)
+	}
+	wg.Wait()
+}
+
+// maxReconnectAttempts bounds how many times multiplexedContainerLogStream
+// will re-open a pod's log stream after it ends, so an ambiguous pod status
+// (e.g. a Get that keeps erroring) can't keep a goroutine alive for as long
+// as the SSE connection stays open.
+const maxReconnectAttempts = 20
+
+// multiplexedContainerLogStream streams a single pod's container log into
+// streamChan as PodLogLine values, re-establishing the stream with a backoff
+// if the pod restarted mid-run. It returns once ctx is done, the job
+// finished normally, or the stream ends without a recoverable error.
+func multiplexedContainerLogStream(ctx context.Context, streamChan chan interface{}, namespace, podName, containerName string, index int, tailLines int64, client kubernetes.Interface, log *zap.SugaredLogger) {
+	retry := &reconnectBackoff{min: time.Second, max: 30 * time.Second}
+
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		out, err := containerlog.GetContainerLogStream(ctx, namespace, podName, containerName, true, tailLines, client)
+		if err != nil {
+			log.Errorf("[GetContainerLogsSSE] failed to open log stream for pod %s: %v", podName, err)
+			if attempt >= maxReconnectAttempts || !retry.sleep(ctx) {
+				return
+			}
+			continue
+		}
+
+		streamEnded := streamPodLogLines(ctx, streamChan, out, podName, index, log)
+		out.Close()
+		if !streamEnded {
+			return
+		}
+
+		if attempt >= maxReconnectAttempts {
+			log.Errorf("[GetContainerLogsSSE] giving up reconnecting to pod %s after %d attempts", podName, attempt+1)
+			return
+		}
+		if !shouldReconnect(ctx, namespace, podName, client, log) {
+			log.Infof("[GetContainerLogsSSE] pod %s is no longer running, not reconnecting", podName)
+			return
+		}
+		if !retry.sleep(ctx) {
+			return
+		}
+	}
+}
+
+// shouldReconnect inspects the pod's current status after its log stream
+// ended to decide whether the job simply finished (stop) or the pod
+// restarted mid-run and a replacement log stream will eventually succeed
+// (reconnect). A pod that can no longer be found, or that has settled into
+// Succeeded/Failed, is treated as finished; anything else - including a
+// transient lookup error - is treated as a restart worth retrying.
+func shouldReconnect(ctx context.Context, namespace, podName string, client kubernetes.Interface, log *zap.SugaredLogger) bool {
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		log.Errorf("[GetContainerLogsSSE] failed to get pod %s while deciding whether to reconnect: %v", podName, err)
+		return true
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded, corev1.PodFailed:
+		return false
+	default:
+		return true
+	}
+}
+
+// streamPodLogLines reads lines from out and emits them as PodLogLine
+// values until ctx is cancelled or the stream ends, returning true when the
+// stream ended (EOF or a read error) so the caller can decide, via
+// shouldReconnect, whether that means the job finished or the pod restarted.
+func streamPodLogLines(ctx context.Context, streamChan chan interface{}, out io.ReadCloser, podName string, index int, log *zap.SugaredLogger) bool {
+	buf := bufio.NewReader(out)
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		default:
+			line, err := buf.ReadString('\n')
+			if line = strings.TrimSpace(line); len(line) > 0 {
+				streamChan <- &PodLogLine{Pod: podName, Index: index, Line: line}
+			}
+			if err == io.EOF {
+				log.Infof("[GetContainerLogsSSE] log stream for pod %s ended", podName)
+				return true
+			}
+			if err != nil {
+				log.Errorf("[GetContainerLogsSSE] scan log stream for pod %s error: %v", podName, err)
+				return true
+			}
+		}
+	}
+}
+
+// reconnectBackoff is a minimal exponential backoff used to re-establish a
+// pod's log stream after it restarts mid-run, without hammering the API
+// server while the replacement pod is still being scheduled.
+type reconnectBackoff struct {
+	min, max, cur time.Duration
+}
+
+func (b *reconnectBackoff) sleep(ctx context.Context) bool {
+	if b.cur == 0 {
+		b.cur = b.min
+	}
+	select {
+	case <-time.After(b.cur):
+	case <-ctx.Done():
+		return false
+	}
+	if b.cur *= 2; b.cur > b.max {
+		b.cur = b.max
 	}
+	return true
 }
 
 func getWorkflowSelector(options *GetContainerOptions) labels.Selector {
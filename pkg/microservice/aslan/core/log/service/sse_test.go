@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+func TestShouldReconnect(t *testing.T) {
+	ctx := context.Background()
+	sugar := log.SugaredLogger()
+
+	cases := []struct {
+		name string
+		pod  *corev1.Pod
+		want bool
+	}{
+		{
+			name: "pod still running, container likely crash-looped",
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "job-0", Namespace: "ns"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+			want: true,
+		},
+		{
+			name: "pod succeeded, job finished normally",
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "job-0", Namespace: "ns"}, Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+			want: false,
+		},
+		{
+			name: "pod failed",
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "job-0", Namespace: "ns"}, Status: corev1.PodStatus{Phase: corev1.PodFailed}},
+			want: false,
+		},
+		{
+			name: "pod garbage collected",
+			pod:  nil,
+			want: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if c.pod != nil {
+				client = fake.NewSimpleClientset(c.pod)
+			}
+			got := shouldReconnect(ctx, "ns", "job-0", client, sugar)
+			if got != c.want {
+				t.Errorf("shouldReconnect() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestReconnectBackoffGrowsAndCaps(t *testing.T) {
+	b := &reconnectBackoff{min: time.Millisecond, max: 4 * time.Millisecond}
+	ctx := context.Background()
+
+	if !b.sleep(ctx) || b.cur != 2*time.Millisecond {
+		t.Fatalf("expected first sleep to grow cur to 2ms, got %v", b.cur)
+	}
+	if !b.sleep(ctx) || b.cur != 4*time.Millisecond {
+		t.Fatalf("expected second sleep to grow cur to 4ms, got %v", b.cur)
+	}
+	if !b.sleep(ctx) || b.cur != 4*time.Millisecond {
+		t.Fatalf("expected backoff to cap at max (4ms), got %v", b.cur)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	archiveservice "github.com/koderover/zadig/pkg/microservice/aslan/core/common/service/log"
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+// GetArchiveRetention handles GET /project/:name/archive-retention,
+// returning the project's configured archived-log retention period in
+// days, or the system default if it has not configured one.
+func GetArchiveRetention(c *gin.Context) {
+	days := archiveservice.GetArchiveRetentionDays(c.Param("name"), log.SugaredLogger())
+	c.JSON(http.StatusOK, gin.H{"retentionDays": days})
+}
+
+// SetArchiveRetention handles PUT /project/:name/archive-retention?retentionDays=N,
+// so a project can configure how long its archived workflow job logs are
+// kept before CleanupAllProjectsExpiredArchives's periodic sweep deletes
+// them.
+func SetArchiveRetention(c *gin.Context) {
+	days, err := strconv.Atoi(c.Query("retentionDays"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid retentionDays"})
+		return
+	}
+
+	if err := archiveservice.SetArchiveRetentionDays(c.Param("name"), days, log.SugaredLogger()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
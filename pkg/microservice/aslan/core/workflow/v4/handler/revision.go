@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package handler exposes WorkflowV4's revision history, diff and rollback
+// over HTTP, so the UI's history tab has somewhere to call.
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	workflowservice "github.com/koderover/zadig/pkg/microservice/aslan/core/workflow/v4/service"
+	"github.com/koderover/zadig/pkg/tool/log"
+)
+
+// ListWorkflowV4Revisions handles GET /workflow/v4/:id/revision, returning
+// a page of the workflow's edit history.
+func ListWorkflowV4Revisions(c *gin.Context) {
+	pageNum, _ := strconv.ParseInt(c.Query("pageNum"), 10, 64)
+	pageSize, _ := strconv.ParseInt(c.Query("pageSize"), 10, 64)
+
+	resp, err := workflowservice.ListWorkflowV4Revisions(c.Param("id"), pageNum, pageSize, log.SugaredLogger())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetWorkflowV4Revision handles GET /workflow/v4/:id/revision/:revision,
+// returning a single historical snapshot.
+func GetWorkflowV4Revision(c *gin.Context) {
+	revision, err := strconv.ParseInt(c.Param("revision"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid revision"})
+		return
+	}
+
+	resp, err := workflowservice.GetWorkflowV4Revision(c.Param("id"), revision, log.SugaredLogger())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DiffWorkflowV4Revisions handles GET /workflow/v4/:id/revision/diff, diffing
+// the two revisions given by the from/to query parameters.
+func DiffWorkflowV4Revisions(c *gin.Context) {
+	from, err := strconv.ParseInt(c.Query("from"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid from revision"})
+		return
+	}
+	to, err := strconv.ParseInt(c.Query("to"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid to revision"})
+		return
+	}
+
+	resp, err := workflowservice.DiffWorkflowV4Revisions(c.Param("id"), from, to, log.SugaredLogger())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RollbackWorkflowV4 handles POST /workflow/v4/:id/rollback, restoring the
+// workflow to the revision given by the revision query parameter.
+func RollbackWorkflowV4(c *gin.Context) {
+	revision, err := strconv.ParseInt(c.Query("revision"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid revision"})
+		return
+	}
+
+	if err := workflowservice.RollbackWorkflowV4(c.Param("id"), revision, c.GetString("username"), log.SugaredLogger()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// RestoreWorkflowV4 handles POST /workflow/v4/:id/restore, clearing the
+// soft-delete flag set when the workflow was last deleted.
+func RestoreWorkflowV4(c *gin.Context) {
+	if err := workflowservice.RestoreWorkflowV4(c.Param("id"), log.SugaredLogger()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
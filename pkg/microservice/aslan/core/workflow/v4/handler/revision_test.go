@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestContext(method, target string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, nil)
+	return c, w
+}
+
+// These cases exercise query/path validation that rejects a request before
+// it ever reaches the Mongo-backed service layer, so they need no database.
+
+func TestGetWorkflowV4RevisionRejectsNonNumericRevision(t *testing.T) {
+	c, w := newTestContext(http.MethodGet, "/workflow/v4/wf1/revision/not-a-number")
+	c.Params = gin.Params{{Key: "id", Value: "wf1"}, {Key: "revision", Value: "not-a-number"}}
+
+	GetWorkflowV4Revision(c)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDiffWorkflowV4RevisionsRejectsMissingFromTo(t *testing.T) {
+	c, w := newTestContext(http.MethodGet, "/workflow/v4/wf1/revision/diff")
+	c.Params = gin.Params{{Key: "id", Value: "wf1"}}
+
+	DiffWorkflowV4Revisions(c)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRollbackWorkflowV4RejectsNonNumericRevision(t *testing.T) {
+	c, w := newTestContext(http.MethodPost, "/workflow/v4/wf1/rollback?revision=oops")
+	c.Params = gin.Params{{Key: "id", Value: "wf1"}}
+
+	RollbackWorkflowV4(c)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/models"
+	commonrepo "github.com/koderover/zadig/pkg/microservice/aslan/core/common/repository/mongodb"
+)
+
+// ListWorkflowV4RevisionsResp is the page of revision history rendered by
+// the UI's history tab for a single workflow.
+type ListWorkflowV4RevisionsResp struct {
+	Revisions []*models.WorkflowV4Revision `json:"revisions"`
+	Total     int64                        `json:"total"`
+}
+
+func ListWorkflowV4Revisions(workflowID string, pageNum, pageSize int64, log *zap.SugaredLogger) (*ListWorkflowV4RevisionsResp, error) {
+	revisions, total, err := commonrepo.NewWorkflowV4RevisionColl().ListRevisions(workflowID, pageNum, pageSize)
+	if err != nil {
+		log.Errorf("failed to list revisions for workflow %s: %s", workflowID, err)
+		return nil, err
+	}
+	return &ListWorkflowV4RevisionsResp{Revisions: revisions, Total: total}, nil
+}
+
+func GetWorkflowV4Revision(workflowID string, revision int64, log *zap.SugaredLogger) (*models.WorkflowV4Revision, error) {
+	rev, err := commonrepo.NewWorkflowV4RevisionColl().GetRevision(workflowID, revision)
+	if err != nil {
+		log.Errorf("failed to get revision %d for workflow %s: %s", revision, workflowID, err)
+		return nil, err
+	}
+	return rev, nil
+}
+
+func DiffWorkflowV4Revisions(workflowID string, from, to int64, log *zap.SugaredLogger) (*commonrepo.RevisionDiff, error) {
+	diff, err := commonrepo.NewWorkflowV4RevisionColl().DiffRevisions(workflowID, from, to)
+	if err != nil {
+		log.Errorf("failed to diff workflow %s revisions %d..%d: %s", workflowID, from, to, err)
+		return nil, err
+	}
+	return diff, nil
+}
+
+// RollbackWorkflowV4 replaces workflowID's live document with the snapshot
+// recorded at revision, with the live document's UpdateBy set to updatedBy.
+// The new revision written by the rollback holds the pre-rollback document
+// and that document's UpdateBy.
+func RollbackWorkflowV4(workflowID string, revision int64, updatedBy string, log *zap.SugaredLogger) error {
+	if err := commonrepo.NewWorkflowV4RevisionColl().Rollback(workflowID, workflowID, revision, updatedBy); err != nil {
+		log.Errorf("failed to roll back workflow %s to revision %d: %s", workflowID, revision, err)
+		return err
+	}
+	return nil
+}
+
+// RestoreWorkflowV4 clears the soft-delete flag on workflowID, so it
+// reappears in listings and can be edited again.
+func RestoreWorkflowV4(workflowID string, log *zap.SugaredLogger) error {
+	if err := commonrepo.NewWorkflowV4Coll().Restore(workflowID); err != nil {
+		log.Errorf("failed to restore workflow %s: %s", workflowID, err)
+		return err
+	}
+	return nil
+}
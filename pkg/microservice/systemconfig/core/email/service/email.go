@@ -0,0 +1,475 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	"github.com/koderover/zadig/pkg/microservice/systemconfig/config"
+	mongotool "github.com/koderover/zadig/pkg/tool/mongo"
+)
+
+const emailHostCollectionName = "email_host"
+
+// OAuth2 holds the credentials needed to keep an OAuth2 access token fresh
+// for relays (Gmail, O365) that require XOAUTH2 instead of a static
+// password.
+type OAuth2 struct {
+	ClientID     string `bson:"client_id"               json:"clientId"`
+	ClientSecret string `bson:"client_secret"            json:"clientSecret"`
+	RefreshToken string `bson:"refresh_token"             json:"refreshToken"`
+	TokenURL     string `bson:"token_url"                json:"tokenUrl"`
+	AccessToken  string `bson:"access_token,omitempty"   json:"accessToken,omitempty"`
+	ExpiresAt    int64  `bson:"expires_at,omitempty"     json:"expiresAt,omitempty"`
+}
+
+// SenderOverride lets a project send notifications from its own From:
+// address through the relay configured here, instead of the system-wide
+// default sender.
+type SenderOverride struct {
+	ProjectName string `bson:"project_name" json:"projectName"`
+	From        string `bson:"from"         json:"from"`
+}
+
+// Email is the system's single SMTP relay configuration. It is stored as
+// one document since zadig only supports one outbound relay at a time;
+// per-project customization is limited to SenderOverrides.
+type Email struct {
+	Name          string `bson:"name"           json:"name"`
+	Port          int    `bson:"port"           json:"port"`
+	Username      string `bson:"username"       json:"username"`
+	Password      string `bson:"password"       json:"password"`
+	Encryption    string `bson:"encryption"     json:"encryption"`
+	AuthMechanism string `bson:"auth_mechanism" json:"authMechanism"`
+	// From is the system-wide default sender address. It is distinct from
+	// Username, which is the SMTP AUTH login and is not necessarily a
+	// deliverable mailbox on every relay.
+	From string `bson:"from,omitempty" json:"from,omitempty"`
+	// OAuth2 is only set when AuthMechanism is "xoauth2".
+	OAuth2 *OAuth2 `bson:"oauth2,omitempty" json:"oauth2,omitempty"`
+	// DKIMKey is the PEM-encoded RSA private key used to sign outgoing
+	// mail's From/To/Subject headers, empty when DKIM signing is not
+	// configured.
+	DKIMKey string `bson:"dkim_key,omitempty" json:"dkimKey,omitempty"`
+	// DKIMSelector is the DKIM selector published alongside the public key
+	// in DNS (the "s=" tag). Defaults to "default" when DKIMKey is set but
+	// this is left empty.
+	DKIMSelector    string           `bson:"dkim_selector,omitempty" json:"dkimSelector,omitempty"`
+	SenderOverrides []SenderOverride `bson:"sender_overrides,omitempty" json:"senderOverrides,omitempty"`
+}
+
+func emailHostColl() *mongo.Collection {
+	return mongotool.Database(config.MongoDatabase()).Collection(emailHostCollectionName)
+}
+
+// GetEmailHostInternal returns the configured SMTP relay. It is called
+// in-process by pkg/shared/client/systemconfig, not over the network.
+func GetEmailHostInternal(log *zap.SugaredLogger) (*Email, error) {
+	resp := new(Email)
+	if err := emailHostColl().FindOne(context.TODO(), bson.M{}).Decode(resp); err != nil {
+		log.Errorf("failed to get email host config: %s", err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// OAuth2TokenResponse is the result of exchanging a refresh token for a new
+// access token.
+type OAuth2TokenResponse struct {
+	AccessToken string
+	ExpiresAt   int64
+}
+
+// RefreshOAuth2TokenInternal exchanges refreshToken for a new access token
+// using the standard OAuth2 refresh-token grant, and persists the result on
+// the stored email host config so the next GetEmailHostInternal call picks
+// it up without another refresh.
+func RefreshOAuth2TokenInternal(clientID, clientSecret, refreshToken, tokenURL string, log *zap.SugaredLogger) (*OAuth2TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+
+	httpResp, err := http.PostForm(tokenURL, form)
+	if err != nil {
+		log.Errorf("failed to refresh oauth2 token: %s", err)
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth2 token refresh failed with status %d", httpResp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode oauth2 token response: %w", err)
+	}
+
+	resp := &OAuth2TokenResponse{
+		AccessToken: body.AccessToken,
+		ExpiresAt:   time.Now().Add(time.Duration(body.ExpiresIn) * time.Second).Unix(),
+	}
+
+	if _, err := emailHostColl().UpdateOne(context.TODO(), bson.M{}, bson.M{"$set": bson.M{
+		"oauth2.access_token": resp.AccessToken,
+		"oauth2.expires_at":   resp.ExpiresAt,
+	}}); err != nil {
+		log.Errorf("failed to persist refreshed oauth2 token: %s", err)
+	}
+
+	return resp, nil
+}
+
+// ErrAuthFailed is returned by SendMailInternal when the relay rejects the
+// SMTP AUTH handshake, so callers can tell an authentication failure apart
+// from a connect or TLS failure and decide whether a token refresh is worth
+// retrying.
+var ErrAuthFailed = errors.New("smtp authentication failed")
+
+// Structured error codes returned by TestSendInternal, mirrored by the
+// client package's TestSendErr* constants so the settings UI can tell a
+// TLS/STARTTLS failure apart from an authentication failure.
+const (
+	testSendErrTLS     = "tls_handshake_failed"
+	testSendErrAuth    = "auth_failed"
+	testSendErrConnect = "connect_failed"
+	testSendErrUnknown = "unknown"
+)
+
+// TestSendResult reports the outcome of a full SMTP handshake/auth attempt
+// triggered from the settings UI's "test send" action.
+type TestSendResult struct {
+	Success   bool
+	ErrorCode string
+	Message   string
+}
+
+// TestSendInternal performs a full SMTP handshake and auth against the
+// configured relay and sends a one-line test message to `to`, reporting
+// which stage failed if any.
+func TestSendInternal(to string, log *zap.SugaredLogger) (*TestSendResult, error) {
+	host, err := GetEmailHostInternal(log)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := SendMailInternal(host, to, "zadig test email", "This is a test email sent from zadig's system settings."); err != nil {
+		code := testSendErrUnknown
+		switch {
+		case errors.Is(err, ErrAuthFailed):
+			code = testSendErrAuth
+		case isTLSError(err):
+			code = testSendErrTLS
+		case isConnectError(err):
+			code = testSendErrConnect
+		}
+		return &TestSendResult{Success: false, ErrorCode: code, Message: err.Error()}, nil
+	}
+
+	return &TestSendResult{Success: true}, nil
+}
+
+// SendMailInternal dials host and sends a single plain-text message to to.
+// It is called both by TestSendInternal and, via
+// pkg/shared/client/systemconfig's SendMail, by notification code paths
+// that need to deliver against a project's sender override.
+func SendMailInternal(host *Email, to, subject, body string) error {
+	return sendMail(host, to, subject, body)
+}
+
+func sendMail(host *Email, to, subject, body string) error {
+	addr := net.JoinHostPort(host.Name, strconv.Itoa(host.Port))
+
+	auth, err := authFor(host)
+	if err != nil {
+		return err
+	}
+
+	msg, err := buildMessage(host, to, subject, body)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %w", err)
+	}
+
+	if host.Encryption == "tls" {
+		return sendWithImplicitTLS(addr, host.Name, auth, host.from(), to, msg)
+	}
+	return sendWithSTARTTLSOrPlain(addr, host.Name, auth, host.Encryption == "starttls", host.from(), to, msg)
+}
+
+func (h *Email) from() string {
+	if h.From != "" {
+		return h.From
+	}
+	return h.Username
+}
+
+func buildMessage(host *Email, to, subject, body string) ([]byte, error) {
+	from := host.from()
+
+	var b strings.Builder
+	if host.DKIMKey != "" {
+		sig, err := dkimSignature(host, from, to, subject, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute dkim signature: %w", err)
+		}
+		b.WriteString(sig)
+	}
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	return []byte(b.String()), nil
+}
+
+// dkimSignature computes an RFC 6376 DKIM-Signature header (simple/simple
+// canonicalization, rsa-sha256) over the From/To/Subject headers and body,
+// so a configured DKIMKey actually signs outgoing mail instead of just
+// being stored.
+func dkimSignature(host *Email, from, to, subject, body string) (string, error) {
+	key, err := parseDKIMPrivateKey(host.DKIMKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid dkim key: %w", err)
+	}
+
+	selector := host.DKIMSelector
+	if selector == "" {
+		selector = "default"
+	}
+
+	bh := sha256.Sum256([]byte(canonicalizeBodySimple(body)))
+	tagsNoSig := fmt.Sprintf("v=1; a=rsa-sha256; c=simple/simple; d=%s; s=%s; h=From:To:Subject; bh=%s; b=",
+		domainOf(from), selector, base64.StdEncoding.EncodeToString(bh[:]))
+
+	var signedHeaders strings.Builder
+	fmt.Fprintf(&signedHeaders, "From: %s\r\n", from)
+	fmt.Fprintf(&signedHeaders, "To: %s\r\n", to)
+	fmt.Fprintf(&signedHeaders, "Subject: %s\r\n", subject)
+	signedHeaders.WriteString("DKIM-Signature: " + tagsNoSig)
+
+	digest := sha256.Sum256([]byte(signedHeaders.String()))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign dkim header: %w", err)
+	}
+
+	return fmt.Sprintf("DKIM-Signature: %s%s\r\n", tagsNoSig, base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+func parseDKIMPrivateKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, fmt.Errorf("not a valid PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	keyIface, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keyIface.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("dkim key is not an RSA private key")
+	}
+	return key, nil
+}
+
+// canonicalizeBodySimple applies DKIM's "simple" body canonicalization
+// (RFC 6376 3.4.3): line endings are normalized to CRLF, trailing empty
+// lines are reduced to the single required trailing CRLF, and a body that
+// lacks a final CRLF gets one; the body is otherwise left unchanged.
+func canonicalizeBodySimple(body string) string {
+	normalized := strings.ReplaceAll(body, "\r\n", "\n")
+	normalized = strings.ReplaceAll(normalized, "\n", "\r\n")
+	for strings.HasSuffix(normalized, "\r\n\r\n") {
+		normalized = strings.TrimSuffix(normalized, "\r\n")
+	}
+	if normalized == "" {
+		return "\r\n"
+	}
+	if !strings.HasSuffix(normalized, "\r\n") {
+		normalized += "\r\n"
+	}
+	return normalized
+}
+
+func domainOf(address string) string {
+	if i := strings.LastIndex(address, "@"); i != -1 {
+		return address[i+1:]
+	}
+	return address
+}
+
+func authFor(host *Email) (smtp.Auth, error) {
+	switch host.AuthMechanism {
+	case "", "plain":
+		return smtp.PlainAuth("", host.Username, host.Password, host.Name), nil
+	case "login":
+		return &loginAuth{username: host.Username, password: host.Password}, nil
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(host.Username, host.Password), nil
+	case "xoauth2":
+		if host.OAuth2 == nil {
+			return nil, fmt.Errorf("xoauth2 auth mechanism configured without oauth2 credentials")
+		}
+		return &xoauth2Auth{username: host.Username, accessToken: host.OAuth2.AccessToken}, nil
+	default:
+		return nil, fmt.Errorf("unsupported auth mechanism %q", host.AuthMechanism)
+	}
+}
+
+func sendWithSTARTTLSOrPlain(addr, serverName string, auth smtp.Auth, useStartTLS bool, from, to string, msg []byte) error {
+	client, err := smtp.Dial(addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp relay: %w", err)
+	}
+	defer client.Close()
+
+	if useStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: serverName}); err != nil {
+				return fmt.Errorf("starttls handshake failed: %w", err)
+			}
+		}
+	}
+
+	return authAndSend(client, auth, from, to, msg)
+}
+
+func sendWithImplicitTLS(addr, serverName string, auth smtp.Auth, from, to string, msg []byte) error {
+	rawConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp relay: %w", err)
+	}
+	conn := tls.Client(rawConn, &tls.Config{ServerName: serverName})
+	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake failed: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, serverName)
+	if err != nil {
+		return fmt.Errorf("failed to establish smtp session: %w", err)
+	}
+	defer client.Close()
+
+	return authAndSend(client, auth, from, to, msg)
+}
+
+func authAndSend(client *smtp.Client, auth smtp.Auth, from, to string, msg []byte) error {
+	if err := client.Auth(auth); err != nil {
+		return fmt.Errorf("%w: %s", ErrAuthFailed, err)
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp RCPT TO failed: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func isTLSError(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "tls handshake failed") || strings.Contains(err.Error(), "starttls handshake failed"))
+}
+
+func isConnectError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "failed to connect to smtp relay")
+}
+
+// loginAuth implements the non-standard but widely deployed AUTH LOGIN
+// mechanism, which net/smtp does not provide.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(string(fromServer)) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q during AUTH LOGIN", fromServer)
+	}
+}
+
+// xoauth2Auth implements the XOAUTH2 SASL mechanism used by Gmail and O365
+// in place of a static password.
+type xoauth2Auth struct {
+	username, accessToken string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, a.accessToken)
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The relay sends a base64 JSON error detail on failure; echoing an
+		// empty response lets the client surface the original SMTP error
+		// instead of hanging the handshake.
+		return []byte{}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The KodeRover Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestEmailFromFallsBackToUsername(t *testing.T) {
+	host := &Email{Username: "ci@example.com"}
+	if got := host.from(); got != "ci@example.com" {
+		t.Errorf("from() = %q, want Username fallback %q", got, "ci@example.com")
+	}
+
+	host.From = "notifications@example.com"
+	if got := host.from(); got != "notifications@example.com" {
+		t.Errorf("from() = %q, want override %q", got, "notifications@example.com")
+	}
+}
+
+func TestAuthForRejectsXOAuth2WithoutCredentials(t *testing.T) {
+	_, err := authFor(&Email{AuthMechanism: "xoauth2"})
+	if err == nil {
+		t.Fatal("expected an error when xoauth2 is configured without oauth2 credentials, got nil")
+	}
+}
+
+func TestAuthForXOAuth2UsesAccessToken(t *testing.T) {
+	auth, err := authFor(&Email{
+		AuthMechanism: "xoauth2",
+		Username:      "ci@example.com",
+		OAuth2:        &OAuth2{AccessToken: "tok123"},
+	})
+	if err != nil {
+		t.Fatalf("authFor() error = %v", err)
+	}
+	x, ok := auth.(*xoauth2Auth)
+	if !ok {
+		t.Fatalf("authFor() = %T, want *xoauth2Auth", auth)
+	}
+	_, resp, err := x.Start(nil)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if !strings.Contains(string(resp), "auth=Bearer tok123") {
+		t.Errorf("Start() response %q does not carry the access token", resp)
+	}
+}
+
+func testDKIMKeyPEM(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate test rsa key: %v", err)
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return string(pem.EncodeToMemory(block)), key
+}
+
+func TestDKIMSignatureVerifiesAndCoversHeadersAndBody(t *testing.T) {
+	keyPEM, key := testDKIMKeyPEM(t)
+	host := &Email{DKIMKey: keyPEM, DKIMSelector: "zadig"}
+
+	sig, err := dkimSignature(host, "notifications@example.com", "user@example.com", "hello", "hi there")
+	if err != nil {
+		t.Fatalf("dkimSignature() error = %v", err)
+	}
+
+	if !strings.HasPrefix(sig, "DKIM-Signature: v=1; a=rsa-sha256; c=simple/simple; d=example.com; s=zadig;") {
+		t.Fatalf("dkimSignature() = %q, missing expected tags", sig)
+	}
+
+	bodyHash := sha256.Sum256([]byte("hi there\r\n"))
+	if wantBH := "bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";"; !strings.Contains(sig, wantBH) {
+		t.Errorf("dkimSignature() = %q, want body hash tag %q", sig, wantBH)
+	}
+
+	bMatch := regexp.MustCompile(`b=([A-Za-z0-9+/=]+)\r\n$`).FindStringSubmatch(sig)
+	if bMatch == nil {
+		t.Fatalf("dkimSignature() = %q, could not find trailing b= signature value", sig)
+	}
+	signature, err := base64.StdEncoding.DecodeString(bMatch[1])
+	if err != nil {
+		t.Fatalf("failed to decode b= signature: %v", err)
+	}
+
+	tagsNoSig := strings.TrimSuffix(sig, bMatch[1]+"\r\n")
+	tagsNoSig = strings.TrimPrefix(tagsNoSig, "DKIM-Signature: ")
+	var signedHeaders strings.Builder
+	signedHeaders.WriteString("From: notifications@example.com\r\n")
+	signedHeaders.WriteString("To: user@example.com\r\n")
+	signedHeaders.WriteString("Subject: hello\r\n")
+	signedHeaders.WriteString("DKIM-Signature: " + tagsNoSig)
+
+	digest := sha256.Sum256([]byte(signedHeaders.String()))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("VerifyPKCS1v15() error = %v, signature does not cover the reconstructed header block", err)
+	}
+}
+
+func TestCanonicalizeBodySimpleCollapsesTrailingBlankLines(t *testing.T) {
+	got := canonicalizeBodySimple("hi there\r\n\r\n\r\n")
+	if want := "hi there\r\n"; got != want {
+		t.Errorf("canonicalizeBodySimple() = %q, want %q", got, want)
+	}
+	if got := canonicalizeBodySimple(""); got != "\r\n" {
+		t.Errorf("canonicalizeBodySimple(\"\") = %q, want %q", got, "\r\n")
+	}
+}
+
+func TestDomainOf(t *testing.T) {
+	if got := domainOf("notifications@example.com"); got != "example.com" {
+		t.Errorf("domainOf() = %q, want %q", got, "example.com")
+	}
+}
+
+func TestIsTLSErrorAndIsConnectErrorHandleNil(t *testing.T) {
+	if isTLSError(nil) {
+		t.Error("isTLSError(nil) = true, want false")
+	}
+	if isConnectError(nil) {
+		t.Error("isConnectError(nil) = true, want false")
+	}
+	if !isTLSError(errors.New("tls handshake failed: x509: certificate signed by unknown authority")) {
+		t.Error("isTLSError() = false for a tls handshake failure, want true")
+	}
+	if !isConnectError(errors.New("failed to connect to smtp relay: dial tcp: timeout")) {
+		t.Error("isConnectError() = false for a connect failure, want true")
+	}
+}
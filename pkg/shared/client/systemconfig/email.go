@@ -17,15 +17,76 @@ limitations under the License.
 package systemconfig
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	emailservice "github.com/koderover/zadig/pkg/microservice/systemconfig/core/email/service"
 	"github.com/koderover/zadig/pkg/tool/log"
 )
 
+// Encryption selects how the connection to the SMTP relay is secured.
+type Encryption string
+
+const (
+	EncryptionNone     Encryption = "none"
+	EncryptionStartTLS Encryption = "starttls"
+	EncryptionTLS      Encryption = "tls"
+)
+
+// AuthMechanism selects the SMTP AUTH mechanism used to authenticate with
+// the relay. XOAuth2 is required by Gmail and O365 once they are configured
+// to reject plain password auth.
+type AuthMechanism string
+
+const (
+	AuthPlain   AuthMechanism = "plain"
+	AuthLogin   AuthMechanism = "login"
+	AuthCRAMMD5 AuthMechanism = "cram-md5"
+	AuthXOAuth2 AuthMechanism = "xoauth2"
+)
+
+// OAuth2Config holds the credentials needed to keep an OAuth2 access token
+// fresh for providers (Gmail, O365) that require XOAUTH2 instead of a
+// static password.
+type OAuth2Config struct {
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	RefreshToken string `json:"refreshToken"`
+	TokenURL     string `json:"tokenUrl"`
+	AccessToken  string `json:"accessToken,omitempty"`
+	ExpiresAt    int64  `json:"expiresAt,omitempty"`
+}
+
+// SenderOverride lets a project send notifications from its own From:
+// address through the relay configured by GetEmailHost, instead of the
+// system-wide default sender.
+type SenderOverride struct {
+	ProjectName string `json:"projectName"`
+	From        string `json:"from"`
+}
+
 type Email struct {
-	Name     string `json:"name"`
-	Port     int    `json:"port"`
-	UserName string `json:"username"`
-	Password string `json:"password"`
+	Name          string        `json:"name"`
+	Port          int           `json:"port"`
+	UserName      string        `json:"username"`
+	Password      string        `json:"password"`
+	Encryption    Encryption    `json:"encryption"`
+	AuthMechanism AuthMechanism `json:"authMechanism"`
+	// From is the address notifications are sent from. It is distinct from
+	// UserName, which is the SMTP AUTH login and is not necessarily a
+	// deliverable mailbox on every relay, so swapping in a project's sender
+	// override must never touch UserName.
+	From string `json:"from,omitempty"`
+	// OAuth2 is only set when AuthMechanism is AuthXOAuth2.
+	OAuth2 *OAuth2Config `json:"oauth2,omitempty"`
+	// DKIMKey is the PEM-encoded RSA private key used to sign outgoing
+	// mail, empty when DKIM signing is not configured.
+	DKIMKey string `json:"dkimKey,omitempty"`
+	// DKIMSelector is the DKIM selector published alongside the public key
+	// in DNS. Defaults to "default" when DKIMKey is set but this is empty.
+	DKIMSelector    string           `json:"dkimSelector,omitempty"`
+	SenderOverrides []SenderOverride `json:"senderOverrides,omitempty"`
 }
 
 func (c *Client) GetEmailHost() (*Email, error) {
@@ -33,12 +94,171 @@ func (c *Client) GetEmailHost() (*Email, error) {
 	if err != nil {
 		return nil, err
 	}
-	res := &Email{
-		Name:     resp.Name,
-		Port:     resp.Port,
-		UserName: resp.Username,
-		Password: resp.Password,
+	return toEmail(resp), nil
+}
+
+// GetEmailHostForProject returns the SMTP relay configuration to use when
+// sending notifications for projectName, with the From: address swapped to
+// the project's configured sender override, if one exists. If the relay
+// uses XOAUTH2 and the cached access token has expired, the token is
+// refreshed before the config is returned.
+func (c *Client) GetEmailHostForProject(projectName string) (*Email, error) {
+	email, err := c.GetEmailHost()
+	if err != nil {
+		return nil, err
+	}
+
+	if email.AuthMechanism == AuthXOAuth2 && email.OAuth2 != nil {
+		if err := c.refreshOAuth2TokenIfExpired(email); err != nil {
+			return nil, fmt.Errorf("failed to refresh oauth2 token: %w", err)
+		}
+	}
+
+	for _, override := range email.SenderOverrides {
+		if override.ProjectName == projectName {
+			email.From = override.From
+			break
+		}
+	}
+
+	return email, nil
+}
+
+func (c *Client) refreshOAuth2TokenIfExpired(email *Email) error {
+	if email.OAuth2.ExpiresAt > time.Now().Unix() {
+		return nil
+	}
+	return c.RefreshOAuth2Token(email)
+}
+
+// RefreshOAuth2Token exchanges the configured refresh token for a new
+// access token and persists it, so the next send doesn't 401 mid-handshake.
+// Notification code paths should also call this reactively whenever the
+// relay itself rejects a send with a 401, since some providers revoke
+// tokens early.
+func (c *Client) RefreshOAuth2Token(email *Email) error {
+	if email.OAuth2 == nil {
+		return fmt.Errorf("email host has no oauth2 config")
+	}
+	resp, err := emailservice.RefreshOAuth2TokenInternal(email.OAuth2.ClientID, email.OAuth2.ClientSecret, email.OAuth2.RefreshToken, email.OAuth2.TokenURL, log.SugaredLogger())
+	if err != nil {
+		return err
+	}
+	email.OAuth2.AccessToken = resp.AccessToken
+	email.OAuth2.ExpiresAt = resp.ExpiresAt
+	return nil
+}
+
+// Structured error codes returned by TestSend, so the settings UI can tell
+// a TLS/STARTTLS failure apart from an authentication failure.
+const (
+	TestSendErrTLS     = "tls_handshake_failed"
+	TestSendErrAuth    = "auth_failed"
+	TestSendErrConnect = "connect_failed"
+	TestSendErrUnknown = "unknown"
+)
+
+// TestSendResult reports the outcome of a full SMTP handshake/auth attempt
+// triggered from the settings UI's "test send" action.
+type TestSendResult struct {
+	Success   bool   `json:"success"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// TestSendEmail attempts a full SMTP handshake and auth against the
+// configured relay, sending a test message to `to` on success, and reports
+// which stage failed otherwise.
+func (c *Client) TestSendEmail(to string) (*TestSendResult, error) {
+	resp, err := emailservice.TestSendInternal(to, log.SugaredLogger())
+	if err != nil {
+		return nil, err
+	}
+	return &TestSendResult{
+		Success:   resp.Success,
+		ErrorCode: resp.ErrorCode,
+		Message:   resp.Message,
+	}, nil
+}
+
+// SendMail sends a notification email for projectName, using that
+// project's sender override and the relay credentials GetEmailHostForProject
+// resolves. Some XOAUTH2 providers revoke an access token before its
+// reported expiry, so a send that fails with an authentication error is
+// retried once after a reactive token refresh instead of only relying on
+// the proactive expiry check in GetEmailHostForProject.
+func (c *Client) SendMail(projectName, to, subject, body string) error {
+	email, err := c.GetEmailHostForProject(projectName)
+	if err != nil {
+		return err
 	}
 
-	return res, err
+	err = emailservice.SendMailInternal(toInternalEmail(email), to, subject, body)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, emailservice.ErrAuthFailed) || email.AuthMechanism != AuthXOAuth2 {
+		return err
+	}
+
+	if refreshErr := c.RefreshOAuth2Token(email); refreshErr != nil {
+		return fmt.Errorf("send failed (%s) and refreshing oauth2 token also failed: %w", err, refreshErr)
+	}
+	return emailservice.SendMailInternal(toInternalEmail(email), to, subject, body)
+}
+
+func toInternalEmail(email *Email) *emailservice.Email {
+	res := &emailservice.Email{
+		Name:          email.Name,
+		Port:          email.Port,
+		Username:      email.UserName,
+		Password:      email.Password,
+		Encryption:    string(email.Encryption),
+		AuthMechanism: string(email.AuthMechanism),
+		From:          email.From,
+		DKIMKey:       email.DKIMKey,
+		DKIMSelector:  email.DKIMSelector,
+	}
+	if email.OAuth2 != nil {
+		res.OAuth2 = &emailservice.OAuth2{
+			ClientID:     email.OAuth2.ClientID,
+			ClientSecret: email.OAuth2.ClientSecret,
+			RefreshToken: email.OAuth2.RefreshToken,
+			TokenURL:     email.OAuth2.TokenURL,
+			AccessToken:  email.OAuth2.AccessToken,
+			ExpiresAt:    email.OAuth2.ExpiresAt,
+		}
+	}
+	return res
+}
+
+func toEmail(resp *emailservice.Email) *Email {
+	res := &Email{
+		Name:          resp.Name,
+		Port:          resp.Port,
+		UserName:      resp.Username,
+		Password:      resp.Password,
+		Encryption:    Encryption(resp.Encryption),
+		AuthMechanism: AuthMechanism(resp.AuthMechanism),
+		From:          resp.From,
+		DKIMKey:       resp.DKIMKey,
+		DKIMSelector:  resp.DKIMSelector,
+	}
+	if resp.OAuth2 != nil {
+		res.OAuth2 = &OAuth2Config{
+			ClientID:     resp.OAuth2.ClientID,
+			ClientSecret: resp.OAuth2.ClientSecret,
+			RefreshToken: resp.OAuth2.RefreshToken,
+			TokenURL:     resp.OAuth2.TokenURL,
+			AccessToken:  resp.OAuth2.AccessToken,
+			ExpiresAt:    resp.OAuth2.ExpiresAt,
+		}
+	}
+	for _, override := range resp.SenderOverrides {
+		res.SenderOverrides = append(res.SenderOverrides, SenderOverride{
+			ProjectName: override.ProjectName,
+			From:        override.From,
+		})
+	}
+	return res
 }